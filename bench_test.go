@@ -0,0 +1,32 @@
+// +build linux
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// BenchmarkExecHostname exercises the full round trip of running a
+// trivial Windows target through wenv, the way the chunk0-6 redesign's
+// "half the wall time of `wenv hostname.exe`" claim should be checked:
+// it shells out to the wenv binary on $PATH rather than calling wenv()
+// in-process, since the thing being measured is process-launch latency
+// across the WSL/Windows boundary, not anything reachable by a normal
+// function call. It only runs where that boundary actually exists.
+func BenchmarkExecHostname(b *testing.B) {
+	if _, err := exec.LookPath("cmd.exe"); err != nil {
+		b.Skip("not running under WSL: cmd.exe not found")
+	}
+	wenvBin, err := exec.LookPath("wenv")
+	if err != nil {
+		b.Skip("wenv not installed on $PATH")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := exec.Command(wenvBin, "hostname.exe").Run(); err != nil {
+			b.Fatalf("wenv hostname.exe: %v", err)
+		}
+	}
+}
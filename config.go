@@ -0,0 +1,174 @@
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rawSection holds a config file section's directives exactly as
+// written, before inherit and clear are resolved against the rest of
+// the file.
+type rawSection struct {
+	inherit string
+	clear   bool
+	ignore  []string
+	pass    []string
+	convert []string
+	path    []string
+}
+
+// config is a parsed wenv config file: one rawSection per "[name]"
+// header, keyed by that name.
+type config struct {
+	sections map[string]rawSection
+}
+
+// configPath returns the config file to use: flagVal (from -config) if
+// set, else $WENV_CONFIG, else ~/.config/wenv/config.
+func configPath(flagVal string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	if e := os.Getenv("WENV_CONFIG"); e != "" {
+		return e
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "wenv", "config")
+}
+
+// loadConfig parses the sectioned key=value file at path. A missing
+// file is not an error: it yields a config with no sections, leaving
+// the builtin defaults as the only rules in effect.
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &config{sections: map[string]rawSection{}}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &config{sections: map[string]rawSection{}}
+	var section string
+	inSection := false
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			inSection = true
+			continue
+		}
+		if !inSection {
+			return nil, fmt.Errorf("%s: directive outside of a section: %q", path, line)
+		}
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid line: %q", path, line)
+		}
+		sec := cfg.sections[section]
+		switch key {
+		case "inherit":
+			sec.inherit = val
+		case "clear":
+			sec.clear = val == "1"
+		case "ignore":
+			sec.ignore = splitNonEmpty(val, ",")
+		case "pass":
+			sec.pass = splitNonEmpty(val, ",")
+		case "convert":
+			sec.convert = splitNonEmpty(val, ",")
+		case "path":
+			sec.path = splitNonEmpty(val, ":")
+		default:
+			return nil, fmt.Errorf("%s: unknown directive %q", path, key)
+		}
+		cfg.sections[section] = sec
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func splitNonEmpty(s, sep string) []string {
+	var out []string
+	for _, e := range strings.Split(s, sep) {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// varoptsFor resolves the effective varopts for target, the basename of
+// the command being run. A section named after target composes with
+// "inherit" and "clear" as described in wenv's doc comment; a target
+// with no matching section gets the same rules as [default].
+func (c *config) varoptsFor(target string) (map[string]varopt, error) {
+	return c.resolve(target, map[string]bool{})
+}
+
+func (c *config) resolve(name string, seen map[string]bool) (map[string]varopt, error) {
+	if seen[name] {
+		return nil, fmt.Errorf("config: inherit cycle at %q", name)
+	}
+	seen[name] = true
+
+	sec, ok := c.sections[name]
+	if !ok {
+		if name == "default" {
+			return copyVaropts(defaultVaropts), nil
+		}
+		return c.resolve("default", seen)
+	}
+
+	var base map[string]varopt
+	var err error
+	switch {
+	case sec.clear:
+		base = map[string]varopt{}
+	case sec.inherit != "":
+		base, err = c.resolve(sec.inherit, seen)
+	case name == "default":
+		base = copyVaropts(defaultVaropts)
+	default:
+		base, err = c.resolve("default", seen)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := func(names []string, opt varopt) {
+		for _, n := range names {
+			base[n] = opt
+		}
+	}
+	set(sec.ignore, varIgnore)
+	set(sec.pass, varPass)
+	set(sec.convert, varConvert)
+	set(sec.path, varPath)
+	return base, nil
+}
+
+func copyVaropts(m map[string]varopt) map[string]varopt {
+	out := make(map[string]varopt, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigMissingFileIsNotError(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "nope"))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.sections) != 0 {
+		t.Fatalf("want no sections, got %v", cfg.sections)
+	}
+}
+
+func TestVaroptsForUnknownTargetUsesDefault(t *testing.T) {
+	path := writeConfig(t, "[default]\nconvert=GOROOT\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cfg.varoptsFor("cl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["GOROOT"] != varConvert {
+		t.Fatalf("want GOROOT converted, got %v", got)
+	}
+	if got["HOME"] != varConvert {
+		t.Fatalf("want builtin defaults to still apply, got %v", got)
+	}
+}
+
+func TestVaroptsForSectionComposesWithDefault(t *testing.T) {
+	path := writeConfig(t, "[default]\nconvert=GOROOT\n\n[go.exe]\nignore=GOPROXY\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cfg.varoptsFor("go.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["GOROOT"] != varConvert {
+		t.Fatalf("want [go.exe] to inherit [default] rules, got %v", got)
+	}
+	if got["GOPROXY"] != varIgnore {
+		t.Fatalf("want GOPROXY ignored, got %v", got)
+	}
+}
+
+func TestVaroptsForClearStartsEmpty(t *testing.T) {
+	path := writeConfig(t, "[default]\nconvert=GOROOT\n\n[cl.exe]\nclear=1\npass=INCLUDE,LIB\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cfg.varoptsFor("cl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["GOROOT"]; ok {
+		t.Fatalf("want clear=1 to drop [default] rules, got %v", got)
+	}
+	if got["INCLUDE"] != varPass || got["LIB"] != varPass {
+		t.Fatalf("want INCLUDE and LIB passed, got %v", got)
+	}
+}
+
+func TestVaroptsForInheritOtherSection(t *testing.T) {
+	path := writeConfig(t, "[default]\nconvert=GOROOT\n\n[base]\nclear=1\nignore=FOO\n\n[go.exe]\ninherit=base\npass=BAR\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cfg.varoptsFor("go.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["GOROOT"]; ok {
+		t.Fatalf("want [go.exe] to inherit [base], not [default], got %v", got)
+	}
+	if got["FOO"] != varIgnore || got["BAR"] != varPass {
+		t.Fatalf("want FOO ignored and BAR passed, got %v", got)
+	}
+}
+
+func TestVaroptsForInheritCycleIsError(t *testing.T) {
+	path := writeConfig(t, "[a]\ninherit=b\n\n[b]\ninherit=a\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.varoptsFor("a"); err == nil {
+		t.Fatal("want error on inherit cycle, got nil")
+	}
+}
+
+func TestLoadConfigRejectsUnknownDirective(t *testing.T) {
+	path := writeConfig(t, "[default]\nbogus=1\n")
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("want error on unknown directive, got nil")
+	}
+}
+
+func TestLoadConfigRejectsDirectiveOutsideSection(t *testing.T) {
+	path := writeConfig(t, "ignore=FOO\n")
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("want error on directive outside section, got nil")
+	}
+}
+
+func TestConfigPathPrecedence(t *testing.T) {
+	old, hadOld := os.LookupEnv("WENV_CONFIG")
+	defer func() {
+		if hadOld {
+			os.Setenv("WENV_CONFIG", old)
+		} else {
+			os.Unsetenv("WENV_CONFIG")
+		}
+	}()
+
+	os.Setenv("WENV_CONFIG", "/env/config")
+	if got := configPath("/flag/config"); got != "/flag/config" {
+		t.Fatalf("want -config flag to win, got %q", got)
+	}
+	if got := configPath(""); got != "/env/config" {
+		t.Fatalf("want $WENV_CONFIG to win absent a flag, got %q", got)
+	}
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/gob"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"rtrn.io/cmd/wenv/handoff"
+)
+
+func TestControlForSignals(t *testing.T) {
+	cases := []struct {
+		sig  syscall.Signal
+		want handoff.Control
+	}{
+		{syscall.SIGINT, handoff.Control{Kind: handoff.ControlSignal, Signal: handoff.CtrlBreak}},
+		{syscall.SIGTERM, handoff.Control{Kind: handoff.ControlSignal, Signal: handoff.CtrlBreak}},
+	}
+	for _, c := range cases {
+		got, ok := controlFor(c.sig)
+		if !ok {
+			t.Fatalf("controlFor(%v): want ok, got false", c.sig)
+		}
+		if got != c.want {
+			t.Fatalf("controlFor(%v) = %+v, want %+v", c.sig, got, c.want)
+		}
+	}
+}
+
+func TestControlForUnhandledSignal(t *testing.T) {
+	if _, ok := controlFor(syscall.SIGHUP); ok {
+		t.Fatal("controlFor(SIGHUP): want ok=false")
+	}
+}
+
+func TestAcceptControlReturnsWhenWenvhelperNeverConnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	returned := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		acceptControl(ln, done)
+		close(returned)
+	}()
+
+	// Closing ln, the way wenv's deferred controlLn.Close() does once the
+	// child exits, must unblock a still-pending Accept rather than leak
+	// the goroutine for good.
+	close(done)
+	ln.Close()
+
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("acceptControl did not return after its listener closed")
+	}
+}
+
+func TestAcceptControlForwardsOverLoopback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go acceptControl(ln, done)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("wenvhelper-side dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// SIGWINCH's default disposition is ignore, so raising it against the
+	// test process itself is safe. Give acceptControl's Accept a moment
+	// to return and forwardControl's signal.Notify a moment to land
+	// before raising it.
+	time.Sleep(50 * time.Millisecond)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctrl handoff.Control
+	if err := gob.NewDecoder(conn).Decode(&ctrl); err != nil {
+		t.Fatalf("decode forwarded control: %v", err)
+	}
+	if ctrl.Kind != handoff.ControlResize {
+		t.Fatalf("got %+v, want a resize control message", ctrl)
+	}
+}
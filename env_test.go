@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "testing"
+
+func TestDedupVarsCaseFolding(t *testing.T) {
+	entries := []envEntry{
+		{key: "Path", val: "C:\\first", explicit: false},
+		{key: "PATH", val: "C:\\second", explicit: true},
+		{key: "path", val: "C:\\third", explicit: false},
+	}
+	vars := dedupVars(entries)
+	if len(vars) != 1 {
+		t.Fatalf("want 1 entry, got %d: %v", len(vars), vars)
+	}
+	if v, ok := vars["PATH"]; !ok || v != "C:\\second" {
+		t.Fatalf("want PATH=C:\\second (explicit rule should win), got %v", vars)
+	}
+}
+
+func TestDedupVarsLastOccurrenceWins(t *testing.T) {
+	entries := []envEntry{
+		{key: "Foo", val: "first"},
+		{key: "FOO", val: "second"},
+		{key: "foo", val: "third"},
+	}
+	vars := dedupVars(entries)
+	if len(vars) != 1 {
+		t.Fatalf("want 1 entry, got %d: %v", len(vars), vars)
+	}
+	if v, ok := vars["foo"]; !ok || v != "third" {
+		t.Fatalf("want foo=third (last occurrence should win), got %v", vars)
+	}
+}
+
+func TestSplitEnvEntry(t *testing.T) {
+	cases := []struct {
+		entry string
+		key   string
+		val   string
+	}{
+		{"PATH=/usr/bin:/bin", "PATH", "/usr/bin:/bin"},
+		{"FOO=", "FOO", ""},
+		{"=C:=C:\\work", "=C:", "C:\\work"},
+		{"=D:=D:\\data\\more=stuff", "=D:", "D:\\data\\more=stuff"},
+	}
+	for _, c := range cases {
+		key, val := splitEnvEntry(c.entry)
+		if key != c.key || val != c.val {
+			t.Fatalf("splitEnvEntry(%q) = (%q, %q), want (%q, %q)", c.entry, key, val, c.key, c.val)
+		}
+	}
+}
+
+func TestDedupVarsSpecialKeysRoundTripThroughRealParse(t *testing.T) {
+	raw := []string{"=C:=C:\\work", "=D:=D:\\data", "PATH=C:\\bin"}
+	var entries []envEntry
+	for _, e := range raw {
+		key, val := splitEnvEntry(e)
+		entries = append(entries, envEntry{key: key, val: val, explicit: key == "PATH"})
+	}
+	vars := dedupVars(entries)
+	if len(vars) != 3 {
+		t.Fatalf("want 3 entries, got %d: %v", len(vars), vars)
+	}
+	if v, ok := vars["=C:"]; !ok || v != "C:\\work" {
+		t.Fatalf("want =C:=C:\\work preserved verbatim, got %v", vars)
+	}
+	if v, ok := vars["=D:"]; !ok || v != "D:\\data" {
+		t.Fatalf("want =D:=D:\\data preserved verbatim, got %v", vars)
+	}
+}
+
+func TestDedupVarsSpecialKeysPreserved(t *testing.T) {
+	entries := []envEntry{
+		{key: "=C:", val: "C:\\work"},
+		{key: "=D:", val: "D:\\data"},
+		{key: "PATH", val: "C:\\bin", explicit: true},
+	}
+	vars := dedupVars(entries)
+	if len(vars) != 3 {
+		t.Fatalf("want 3 entries, got %d: %v", len(vars), vars)
+	}
+	if v, ok := vars["=C:"]; !ok || v != "C:\\work" {
+		t.Fatalf("want =C:=C:\\work preserved verbatim, got %v", vars)
+	}
+	if v, ok := vars["=D:"]; !ok || v != "D:\\data" {
+		t.Fatalf("want =D:=D:\\data preserved verbatim, got %v", vars)
+	}
+}
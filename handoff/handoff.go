@@ -0,0 +1,63 @@
+// Package handoff defines the data wenv hands off to wenvhelper, and the
+// control messages the two exchange for the life of the child process.
+// Both are gob-encoded: the Payload onto a base64 argv, the Control
+// messages over a TCP loopback connection wenv listens on and
+// wenvhelper dials back into, per Payload.ControlAddr. A loopback
+// connection is used instead of an inherited file descriptor because WSL
+// interop only documents stdio (fds 0-2) as being forwarded into the
+// Win32 process it launches; anything past fd 2 would need its own
+// inheritance path across that boundary, while loopback TCP is routed by
+// WSL2 regardless of which side listens.
+//
+// Both wenv and wenvhelper import this package, so it carries no build
+// constraint of its own.
+package handoff // import "rtrn.io/cmd/wenv/handoff"
+
+// Payload is gob-encoded, then base64-encoded onto the argv wenv hands
+// off to wenvhelper.
+type Payload struct {
+	Vars map[string]string
+
+	// TTY requests a ConPTY-backed interactive session sized Cols by Rows;
+	// both are ignored when TTY is false.
+	TTY        bool
+	Cols, Rows uint16
+
+	// ControlAddr is the "host:port" of the loopback listener wenv holds
+	// open for the life of the child; wenvhelper dials it to receive
+	// Control messages. Empty if wenv failed to open the listener, in
+	// which case wenvhelper runs without signal/resize forwarding rather
+	// than fail the whole invocation over it.
+	ControlAddr string
+}
+
+// Signal is a Windows console control event, raised in the child's
+// process group via GenerateConsoleCtrlEvent. The values match the
+// CTRL_C_EVENT and CTRL_BREAK_EVENT constants directly.
+type Signal uint32
+
+const (
+	CtrlC     Signal = 0
+	CtrlBreak Signal = 1
+)
+
+// ControlKind identifies what a Control message carries.
+type ControlKind int
+
+const (
+	_ ControlKind = iota
+	ControlSignal
+	ControlResize
+)
+
+// Control is a single message wenv sends over the control pipe, one
+// gob-encoded value per message, for as long as the child runs.
+type Control struct {
+	Kind ControlKind
+
+	// Signal is valid when Kind is ControlSignal.
+	Signal Signal
+
+	// Cols and Rows are valid when Kind is ControlResize.
+	Cols, Rows uint16
+}
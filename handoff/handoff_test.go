@@ -0,0 +1,39 @@
+package handoff
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	want := Payload{Vars: map[string]string{"HOME": `C:\Users\me`}, TTY: true, Cols: 80, Rows: 24}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(want); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var got Payload
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.TTY != want.TTY || got.Cols != want.Cols || got.Rows != want.Rows || got.Vars["HOME"] != want.Vars["HOME"] {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestControlRoundTrip(t *testing.T) {
+	want := Control{Kind: ControlResize, Cols: 100, Rows: 40}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(want); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var got Control
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,360 @@
+// +build linux
+
+// Package pathconv converts paths between their WSL and Windows
+// representations.
+//
+// Conversion is delegated to the wslpath utility shipped with WSL, which
+// understands UNC paths into other distros, WSL2 9P roots and symlinks
+// crossing the Windows/Linux boundary — none of which the regexp-based
+// /mnt/<drive> rewriting in this package's fallback can. wslpath is only
+// skipped, in favor of that fallback, when it is not found on $PATH.
+package pathconv // import "rtrn.io/cmd/wenv/pathconv"
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mode selects which of wslpath's conversions to perform.
+type Mode int
+
+const (
+	Windows Mode = iota // wslpath -w, e.g. C:\Users\me
+	Mixed               // wslpath -m, e.g. C:/Users/me
+	Linux               // wslpath -u, e.g. /mnt/c/Users/me
+)
+
+func (m Mode) flag() string {
+	switch m {
+	case Windows:
+		return "-w"
+	case Mixed:
+		return "-m"
+	case Linux:
+		return "-u"
+	default:
+		panic("pathconv: invalid mode")
+	}
+}
+
+// NoMappingError reports that path has no counterpart across the
+// WSL/Windows boundary, such as a Linux-only path with no DrvFs mount.
+// Callers are expected to decide for themselves whether to drop the
+// variable that held the path or keep it unconverted.
+type NoMappingError struct {
+	Path string
+}
+
+func (e *NoMappingError) Error() string {
+	return fmt.Sprintf("pathconv: %s: no mapping across the WSL/Windows boundary", e.Path)
+}
+
+const cacheSize = 256
+
+var (
+	toWindows = newCache(cacheSize)
+	toMixed   = newCache(cacheSize)
+	toLinux   = newCache(cacheSize)
+)
+
+func cacheFor(mode Mode) *cache {
+	switch mode {
+	case Windows:
+		return toWindows
+	case Mixed:
+		return toMixed
+	case Linux:
+		return toLinux
+	default:
+		panic("pathconv: invalid mode")
+	}
+}
+
+// ToWindows converts a WSL path to its Windows equivalent, e.g.
+// "/mnt/c/Users/me" to "C:\Users\me".
+func ToWindows(path string) (string, error) { return convert(Windows, path) }
+
+// ToMixed converts a WSL path to Windows' forward-slash form, e.g.
+// "/mnt/c/Users/me" to "C:/Users/me".
+func ToMixed(path string) (string, error) { return convert(Mixed, path) }
+
+// ToLinux converts a Windows path to its WSL equivalent, e.g.
+// "C:\Users\me" to "/mnt/c/Users/me".
+func ToLinux(path string) (string, error) { return convert(Linux, path) }
+
+// ToWindowsAll converts a batch of WSL paths to their Windows equivalents,
+// invoking wslpath once for every path missing from the cache instead of
+// once per path. Unlike ToWindows, a path that fails to convert does not
+// stop the rest of the batch: its slot in errs holds the error (typically
+// a *NoMappingError) and the matching slot in the result holds "", leaving
+// the caller free to drop or keep that one entry.
+func ToWindowsAll(paths []string) (results []string, errs []error) {
+	return convertAll(Windows, paths)
+}
+
+func convert(mode Mode, path string) (string, error) {
+	c := cacheFor(mode)
+	if v, ok := c.get(path); ok {
+		return v, nil
+	}
+	out, err := convertOne(mode, path)
+	if err != nil {
+		return "", err
+	}
+	c.put(path, out)
+	return out, nil
+}
+
+func convertOne(mode Mode, path string) (string, error) {
+	if wslpathBin, ok := lookWslpath(); ok {
+		return runWslpath(wslpathBin, mode, path)
+	}
+	return fallback(mode, path)
+}
+
+func convertAll(mode Mode, paths []string) ([]string, []error) {
+	c := cacheFor(mode)
+	results := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	var miss []int
+	for i, p := range paths {
+		if v, ok := c.get(p); ok {
+			results[i] = v
+			continue
+		}
+		miss = append(miss, i)
+	}
+	if len(miss) == 0 {
+		return results, errs
+	}
+
+	missPaths := make([]string, len(miss))
+	for i, idx := range miss {
+		missPaths[i] = paths[idx]
+	}
+
+	out, batchErrs := convertBatch(mode, missPaths)
+	for i, idx := range miss {
+		if batchErrs[i] != nil {
+			errs[idx] = batchErrs[i]
+			continue
+		}
+		results[idx] = out[i]
+		c.put(missPaths[i], out[i])
+	}
+	return results, errs
+}
+
+func convertBatch(mode Mode, paths []string) ([]string, []error) {
+	results := make([]string, len(paths))
+	errs := make([]error, len(paths))
+
+	wslpathBin, ok := lookWslpath()
+	if !ok {
+		for i, p := range paths {
+			results[i], errs[i] = fallback(mode, p)
+		}
+		return results, errs
+	}
+
+	// Some wslpath builds accept more than one positional path and convert
+	// each to its own output line; try a single call with every path
+	// first. Since that isn't documented behavior, every line is checked
+	// against plausibleConversion before it's trusted, and the whole
+	// batch falls back to one invocation per path at the first line that
+	// doesn't look converted rather than risk passing a path through
+	// unconverted or silently swallowing a *NoMappingError.
+	args := append([]string{mode.flag()}, paths...)
+	out, err := exec.Command(wslpathBin, args...).Output()
+	if err == nil {
+		lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+		if len(lines) == len(paths) && allPlausible(mode, lines) {
+			return lines, errs
+		}
+	}
+
+	for i, p := range paths {
+		results[i], errs[i] = runWslpath(wslpathBin, mode, p)
+	}
+	return results, errs
+}
+
+var (
+	wslpathOnce sync.Once
+	wslpathBin  string
+)
+
+func lookWslpath() (string, bool) {
+	wslpathOnce.Do(func() {
+		wslpathBin, _ = exec.LookPath("wslpath")
+	})
+	return wslpathBin, wslpathBin != ""
+}
+
+func runWslpath(bin string, mode Mode, path string) (string, error) {
+	out, err := exec.Command(bin, mode.flag(), path).Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", &NoMappingError{Path: path}
+		}
+		return "", fmt.Errorf("pathconv: exec wslpath: %w", err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// allPlausible reports whether every line looks like a real conversion
+// for mode rather than a blank or an unconverted echo of the input, the
+// way runWslpath's single-path *NoMappingError would catch.
+func allPlausible(mode Mode, lines []string) bool {
+	for _, line := range lines {
+		if !plausibleConversion(mode, line) {
+			return false
+		}
+	}
+	return true
+}
+
+func plausibleConversion(mode Mode, out string) bool {
+	if out == "" {
+		return false
+	}
+	switch mode {
+	case Linux:
+		return strings.HasPrefix(out, "/")
+	case Windows, Mixed:
+		return strings.Contains(out, ":") || strings.HasPrefix(out, `\\`) || strings.HasPrefix(out, "//")
+	default:
+		return false
+	}
+}
+
+// fallback reproduces wenv's original regexp-based conversion, used only
+// when wslpath is not installed. It only understands the /mnt/<drive>
+// DrvFs convention and cannot see UNC paths, 9P roots or symlinks that
+// cross the boundary.
+func fallback(mode Mode, path string) (string, error) {
+	switch mode {
+	case Windows, Mixed:
+		return fallbackToWindows(path, mode)
+	case Linux:
+		return fallbackToLinux(path), nil
+	default:
+		panic("pathconv: invalid mode")
+	}
+}
+
+func fallbackToWindows(path string, mode Mode) (string, error) {
+	root := wslRoot()
+	re := regexp.MustCompile("^" + root + "([a-z])(/|$)")
+	match := re.FindStringSubmatch(path)
+	if match != nil {
+		repl := strings.ToUpper(match[1]) + ":"
+		re = regexp.MustCompile("^" + root + "[a-z]")
+		path = re.ReplaceAllString(path, repl)
+	}
+	if mode == Windows {
+		path = strings.Replace(path, "/", "\\", -1)
+	}
+
+	if strings.HasPrefix(path, "/") || strings.HasPrefix(path, "\\") {
+		return "", &NoMappingError{Path: path}
+	}
+	return path, nil
+}
+
+func fallbackToLinux(path string) string {
+	root := wslRoot()
+	path = strings.Replace(path, "\\", "/", -1)
+	re := regexp.MustCompile("^([A-Za-z]):")
+	match := re.FindStringSubmatch(path)
+	if match != nil {
+		repl := root + strings.ToLower(match[1])
+		path = re.ReplaceAllString(path, repl)
+	}
+	return path
+}
+
+var (
+	wslRootOnce  sync.Once
+	wslRootValue string
+)
+
+func wslRoot() string {
+	wslRootOnce.Do(func() {
+		wslRootValue = "/mnt/"
+		b, err := ioutil.ReadFile("/etc/wsl.conf")
+		if err != nil {
+			return
+		}
+		for _, s := range strings.Split(string(b), "\n") {
+			if !strings.Contains(s, "root") {
+				continue
+			}
+			split := strings.SplitN(s, "=", 2)
+			if len(split) != 2 {
+				return
+			}
+			v := strings.TrimSpace(split[1])
+			if v == "" {
+				return
+			}
+			if v[0] == '"' {
+				v = v[1 : len(v)-1]
+			}
+			wslRootValue = v
+			return
+		}
+	})
+	return wslRootValue
+}
+
+// cache is a small LRU cache mapping an input path to its converted form,
+// sized to comfortably hold everything a single wenv invocation looks up
+// (HOME, GOBIN and each PATH element) with room to spare across repeated
+// invocations sharing a process, such as wrapper scripts run in a loop.
+type cache struct {
+	mu    sync.Mutex
+	cap   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key, val string
+}
+
+func newCache(cap int) *cache {
+	return &cache{cap: cap, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *cache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry).val, true
+}
+
+func (c *cache) put(key, val string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).val = val
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, val})
+	if c.ll.Len() > c.cap {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,74 @@
+// +build linux
+
+package pathconv
+
+import "testing"
+
+func TestFallbackToWindows(t *testing.T) {
+	got, err := fallbackToWindows("/mnt/c/Users/me", Windows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "C:\\Users\\me"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFallbackToWindowsNoMapping(t *testing.T) {
+	_, err := fallbackToWindows("/home/me", Windows)
+	if _, ok := err.(*NoMappingError); !ok {
+		t.Fatalf("got %v, want *NoMappingError", err)
+	}
+}
+
+func TestFallbackToLinux(t *testing.T) {
+	got := fallbackToLinux("C:\\Users\\me")
+	if want := "/mnt/c/Users/me"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlausibleConversion(t *testing.T) {
+	cases := []struct {
+		mode Mode
+		out  string
+		want bool
+	}{
+		{Linux, "/mnt/c/Users/me", true},
+		{Linux, "", false},
+		{Linux, `C:\Users\me`, false},
+		{Windows, `C:\Users\me`, true},
+		{Windows, "/mnt/c/Users/me", false},
+		{Mixed, "C:/Users/me", true},
+		{Mixed, "", false},
+	}
+	for _, c := range cases {
+		if got := plausibleConversion(c.mode, c.out); got != c.want {
+			t.Errorf("plausibleConversion(%v, %q) = %v, want %v", c.mode, c.out, got, c.want)
+		}
+	}
+}
+
+func TestAllPlausibleRejectsOneBadLine(t *testing.T) {
+	lines := []string{"/mnt/c/Users/me", "", "/mnt/c/Users/you"}
+	if allPlausible(Linux, lines) {
+		t.Fatal("want false when any line fails plausibleConversion")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2)
+	c.put("a", "1")
+	c.put("b", "2")
+	c.put("c", "3") // evicts "a", the least recently used
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("want \"a\" evicted")
+	}
+	if v, ok := c.get("b"); !ok || v != "2" {
+		t.Fatalf("got %q, %v, want \"2\", true", v, ok)
+	}
+	if v, ok := c.get("c"); !ok || v != "3" {
+		t.Fatalf("got %q, %v, want \"3\", true", v, ok)
+	}
+}
@@ -1,3 +1,4 @@
+//go:build linux
 // +build linux
 
 // Wenv passes environment variables to Windows applications
@@ -5,34 +6,67 @@
 //
 // Usage:
 //
-//	wenv 'var=x' ... command.exe [arg ...]
-//	[var=x ...] wenv command.exe [arg ...]
+//	wenv [-t] 'var=x' ... command.exe [arg ...]
+//	[var=x ...] wenv [-t] command.exe [arg ...]
 //
 // The first form will only pass the variables specified on the command line.
 // The second form takes the whole environment and passes it to
 // the command while following the rules stated below.
 //
+// The -t flag allocates a Windows console (ConPTY) for the command and
+// pumps its input and output through the calling terminal, forwarding
+// window resizes and Ctrl-C/Ctrl-Break along the way; it is assumed
+// automatically when stdin is itself a terminal.
+//
 // Note that environment variables are case sensitive inside WSL and case insensitive
-// on the Windows side.
+// on the Windows side. When WSL's environment holds multiple spellings of the same
+// variable (“PATH”, “Path”, “path”, ...), wenv collapses them to a single
+// entry before the hand-off: a spelling with an explicit rule above wins over one
+// without, and the last matching spelling in the environment wins any further tie.
 //
-// Default Rules
+// # Default Rules
 //
 // The following environment variables are ignored: home, path, ifs, IFS, SHELL,
 // prompt, EDITOR, PAGER, BROWSER.
 // And the following variables are converted to Windows paths: HOME, GOBIN.
-// Finally, ``PATH'' and ``GOPATH'' are converted such that they match their Windows equivalent.
+// Finally, “PATH” and “GOPATH” are converted such that they match their Windows equivalent.
 // Every other variable is passed as-is.
 //
-// These can be changed and new rules can be added using the ``WENV'' environment
+// These can be changed and new rules can be added using the “WENV” environment
 // variable, which is a comma-separated list of variables optionally prefixed by a modifier:
 //
 //	WENV='var1, !var2, @var3, #var4, $var5'
 //
-// Variables prefixed by ``!'' are ignored.  Those prefixed by ``@'' are converted to Windows
-// paths.  ``#'' denotes a path variable.  ``$'' is the same as no prefix and can be used to
+// Variables prefixed by “!” are ignored.  Those prefixed by “@” are converted to Windows
+// paths.  “#” denotes a path variable.  “$” is the same as no prefix and can be used to
 // pass a variable whose name would otherwise be interpreted as a modifier.
 //
-// Wrapper Scripts
+// # Config File
+//
+// For rules that depend on the command being run, wenv also reads a config file, by
+// default “~/.config/wenv/config”, overridable with “-config” or “$WENV_CONFIG”. It
+// is sectioned key=value, with each section named after the basename of the command being
+// run (“[go.exe]”) and a “[default]” section seeding the rules every other section
+// starts from:
+//
+//	[default]
+//	ignore=home,path,ifs,IFS,SHELL,prompt,EDITOR,PAGER,BROWSER
+//	convert=HOME,GOBIN
+//	path=PATH:GOPATH
+//
+//	[go.exe]
+//	convert=GOROOT
+//
+//	[cl.exe]
+//	clear=1
+//	pass=INCLUDE,LIB
+//
+// Supported directives are “ignore=”, “pass=”, “convert=” (comma-joined variable
+// lists) and “path=” (colon-joined). “inherit=other-section” starts a section from
+// another one instead of “[default]”; “clear=1” starts it from no rules at all. The
+// “WENV” variable above is still honored as an ad-hoc overlay applied after the file.
+//
+// # Wrapper Scripts
 //
 // Consider creating wrapper scripts for commands you run often:
 //
@@ -43,20 +77,28 @@
 //
 //	#!/usr/local/plan9/bin/rc
 //	exec wenv command.exe $*
-//
 package main // import "rtrn.io/cmd/wenv"
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
-	"regexp"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"unsafe"
+
+	"rtrn.io/cmd/wenv/handoff"
+	"rtrn.io/cmd/wenv/pathconv"
+	"rtrn.io/cmd/wenv/winlookup"
 )
 
 const helper = "wenvhelper.exe"
@@ -70,7 +112,7 @@ const (
 	varPath
 )
 
-var varopts = map[string]varopt{
+var defaultVaropts = map[string]varopt{
 	"home":    varIgnore,
 	"path":    varIgnore,
 	"ifs":     varIgnore,
@@ -95,8 +137,8 @@ func main() {
 }
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: wenv 'var=x' ... command.exe [arg ...]")
-	fmt.Fprintln(os.Stderr, "       [var=x ...] wenv command.exe [arg ...]")
+	fmt.Fprintln(os.Stderr, "usage: wenv [-t] [-config file] 'var=x' ... command.exe [arg ...]")
+	fmt.Fprintln(os.Stderr, "       [var=x ...] wenv [-t] [-config file] command.exe [arg ...]")
 	os.Exit(2)
 }
 
@@ -106,6 +148,31 @@ func wenv() int {
 		usage()
 	}
 
+	interactive := false
+	configFlag := ""
+flags:
+	for len(os.Args) > 0 {
+		switch os.Args[0] {
+		case "-t":
+			interactive = true
+			os.Args = os.Args[1:]
+		case "-config":
+			if len(os.Args) < 2 {
+				usage()
+			}
+			configFlag = os.Args[1]
+			os.Args = os.Args[2:]
+		default:
+			break flags
+		}
+	}
+	if len(os.Args) == 0 {
+		usage()
+	}
+	if !interactive {
+		interactive = isTerminal(os.Stdin)
+	}
+
 	vars := make(map[string]string)
 	for len(os.Args) > 0 {
 		v := strings.SplitN(os.Args[0], "=", 2)
@@ -119,96 +186,309 @@ func wenv() int {
 		usage()
 	}
 	if len(vars) == 0 {
-		if err := getvaropts(); err != nil {
+		cfg, err := loadConfig(configPath(configFlag))
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		varopts, err := cfg.varoptsFor(filepath.Base(os.Args[0]))
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := getvaropts(varopts); err != nil {
 			log.Print(err)
 			return 1
 		}
+		var entries []envEntry
 		for _, e := range os.Environ() {
-			v := strings.SplitN(e, "=", 2)
-			if opt, ok := varopts[v[0]]; ok {
+			key, val := splitEnvEntry(e)
+			opt, explicit := varopts[key]
+			if explicit {
 				switch opt {
 				case varIgnore:
 					continue
 				case varPass:
 				case varConvert:
 					var err error
-					v[1], err = winpath(v[1])
+					val, err = pathconv.ToWindows(val)
 					if err != nil {
 						continue
 					}
 				case varPath:
+					elems, errs := pathconv.ToWindowsAll(strings.Split(val, ":"))
 					var p []string
-					for _, e := range strings.Split(v[1], ":") {
-						e, err := winpath(e)
-						if err != nil {
+					for i, e := range elems {
+						if errs[i] != nil {
 							continue
 						}
 						p = append(p, e)
 					}
-					v[1] = strings.Join(p, ";")
+					val = strings.Join(p, ";")
 				default:
 					log.Print("invalid varopt: ", opt)
 					return 1
 				}
 			}
-			vars[v[0]] = v[1]
+			entries = append(entries, envEntry{key: key, val: val, explicit: explicit})
 		}
+		vars = dedupVars(entries)
 	}
 
-	path, err := exec.LookPath(os.Args[0])
+	_, path, err := winlookup.LookWindows(os.Args[0])
 	if err != nil {
 		log.Print(err)
 		return 127
 	}
-	path, err = winpath(path)
-	if err != nil {
-		log.Printf("%s: could not convert to Windows path", os.Args[0])
-		return 126
+
+	payload := handoff.Payload{Vars: vars, TTY: interactive}
+	if interactive {
+		payload.Cols, payload.Rows = terminalSize(os.Stdin)
 	}
 
-	cmdout, err := exec.Command("cmd.exe", "/c", "echo %TEMP%").Output()
+	cmd, err := exec.LookPath(helper)
 	if err != nil {
-		log.Printf("exec cmd.exe: %v", err)
+		log.Print(err)
 		return 1
 	}
-	tempdir := wslpath(strings.TrimSpace(string(cmdout)))
-	file, err := ioutil.TempFile(tempdir, "wenv")
+
+	// The control channel is a loopback listener, not an extra file
+	// descriptor: WSL interop only documents stdio (fds 0-2) as being
+	// forwarded into the Win32 process it launches, so wenvhelper
+	// couldn't reliably inherit anything past fd 2 across that boundary.
+	// wenvhelper dials the address back in over TCP instead, which WSL2
+	// routes regardless of which side is listening. A listener that
+	// fails to open just means no signal/resize forwarding, not a failed
+	// invocation, so the error is logged rather than fatal.
+	var controlLn net.Listener
+	controlLn, err = net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		log.Printf("creating temp file: %v", err)
-		return 1
+		log.Print(err)
+	} else {
+		defer controlLn.Close()
+		payload.ControlAddr = controlLn.Addr().String()
 	}
 
-	enc := gob.NewEncoder(file)
-	if err := enc.Encode(vars); err != nil {
+	// The payload itself travels as a base64-encoded argv for the same
+	// reason: argv is the one channel WSL interop is documented to carry
+	// into the Win32 process it launches.
+	var payloadBuf bytes.Buffer
+	if err := gob.NewEncoder(&payloadBuf).Encode(payload); err != nil {
 		log.Printf("gob encoding: %v", err)
 		return 1
 	}
-	if err := file.Close(); err != nil {
-		log.Printf("closing temp file: %v", err)
-		return 1
+	blob := base64.StdEncoding.EncodeToString(payloadBuf.Bytes())
+	args := append([]string{helper, blob, path}, os.Args...)
+
+	child := exec.Cmd{
+		Path:   cmd,
+		Args:   args,
+		Env:    os.Environ(),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if interactive {
+		oldState, err := makeRaw(os.Stdin.Fd())
+		if err != nil {
+			log.Printf("making terminal raw: %v", err)
+			return 1
+		}
+		defer restoreTerminal(os.Stdin.Fd(), oldState)
 	}
-	defer os.Remove(file.Name())
 
-	cmd, err := exec.LookPath(helper)
-	if err != nil {
-		log.Print(err)
+	if err := child.Start(); err != nil {
+		log.Printf("exec: %v", err)
 		return 1
 	}
-	winfile, err := winpath(file.Name())
+
+	done := make(chan struct{})
+	if controlLn != nil {
+		go acceptControl(controlLn, done)
+	}
+
+	code := 0
+	if err := child.Wait(); err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				code = status.ExitStatus()
+			}
+		} else {
+			log.Print(err)
+			code = 1
+		}
+	}
+	close(done)
+	return code
+}
+
+// acceptControl waits for wenvhelper to dial ln back, then forwards
+// control messages over that connection for as long as the child runs.
+// It gives up once done closes, whether or not wenvhelper ever connected
+// (the deferred controlLn.Close() in wenv unblocks a still-pending
+// Accept).
+func acceptControl(ln net.Listener, done <-chan struct{}) {
+	conn, err := ln.Accept()
 	if err != nil {
-		log.Printf("%s: could not convert to Windows path", file.Name())
-		return 1
+		return
 	}
-	args := append([]string{helper}, winfile, path)
-	args = append(args, os.Args...)
-	if err := syscall.Exec(cmd, args, os.Environ()); err != nil {
-		log.Printf("exec: %v", err)
-		return 1
+	defer conn.Close()
+	forwardControl(conn, done)
+}
+
+// forwardControl relays SIGINT, SIGTERM and terminal resizes to
+// wenvhelper over w for as long as done is open, so it can raise the
+// matching console control event or resize the ConPTY. Both signals map
+// to CTRL_BREAK_EVENT: the child runs in its own process group (see
+// run/runInteractive in wenvhelper), and Windows only delivers
+// CTRL_C_EVENT to group 0, so CTRL_BREAK_EVENT is the only event that
+// actually reaches it.
+func forwardControl(w io.Writer, done <-chan struct{}) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH)
+	defer signal.Stop(sig)
+
+	enc := gob.NewEncoder(w)
+	for {
+		select {
+		case <-done:
+			return
+		case s := <-sig:
+			ctrl, ok := controlFor(s)
+			if !ok {
+				continue
+			}
+			if err := enc.Encode(ctrl); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func controlFor(s os.Signal) (handoff.Control, bool) {
+	switch s {
+	case syscall.SIGINT, syscall.SIGTERM:
+		return handoff.Control{Kind: handoff.ControlSignal, Signal: handoff.CtrlBreak}, true
+	case syscall.SIGWINCH:
+		cols, rows := terminalSize(os.Stdin)
+		return handoff.Control{Kind: handoff.ControlResize, Cols: cols, Rows: rows}, true
+	default:
+		return handoff.Control{}, false
 	}
-	panic("not reached")
 }
 
-func getvaropts() error {
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// terminalSize reads f's window size via TIOCGWINSZ, returning 0, 0 if f
+// is not a terminal.
+func terminalSize(f *os.File) (cols, rows uint16) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0
+	}
+	return ws.cols, ws.rows
+}
+
+// makeRaw puts the terminal on fd into raw mode, returning its previous
+// state so the caller can restore it with restoreTerminal. Input is
+// otherwise left cooked and echoed by the WSL tty, which doubles up with
+// the ConPTY's own echo and line-buffers keystrokes the interactive
+// child expects byte by byte.
+func makeRaw(fd uintptr) (*syscall.Termios, error) {
+	var oldState syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&oldState))); errno != 0 {
+		return nil, errno
+	}
+	raw := oldState
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return nil, errno
+	}
+	return &oldState, nil
+}
+
+// restoreTerminal puts the terminal on fd back into the state makeRaw
+// found it in.
+func restoreTerminal(fd uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// splitEnvEntry splits a raw os.Environ() entry into its key and value.
+// Entries beginning with "=", such as Windows' per-drive
+// current-directory variables (key "=C:", entry "=C:=C:\work"), carry
+// their own leading "=" as part of the key, so the split happens on the
+// next "=" instead of the first.
+func splitEnvEntry(e string) (key, val string) {
+	if strings.HasPrefix(e, "=") {
+		if i := strings.IndexByte(e[1:], '='); i >= 0 {
+			return e[:i+1], e[i+2:]
+		}
+		return e, ""
+	}
+	key, val, _ = strings.Cut(e, "=")
+	return key, val
+}
+
+// envEntry is a single WSL-side environment variable staged for hand-off
+// to Windows, tagged with whether its exact spelling matched an explicit
+// varopts rule.
+type envEntry struct {
+	key      string
+	val      string
+	explicit bool
+}
+
+// dedupVars collapses entries whose keys collide once folded to the case
+// insensitive form Windows uses, modeled on os/exec.dedupEnv. For a given
+// folded key, an entry with an explicit varopts rule always beats one
+// without; among entries of equal standing, the later one (as found in
+// os.Environ()) wins. Keys beginning with "=", such as the Windows
+// per-drive current-directory entries ("=C:"), are never case-folded or
+// collapsed against one another since each is a distinct, legitimate key.
+func dedupVars(entries []envEntry) map[string]string {
+	type slot struct {
+		entry envEntry
+		set   bool
+	}
+	winners := make(map[string]slot, len(entries))
+	for _, e := range entries {
+		fold := strings.ToLower(e.key)
+		if strings.HasPrefix(e.key, "=") {
+			fold = e.key
+		}
+		cur, ok := winners[fold]
+		if !ok || e.explicit || (cur.entry.explicit == e.explicit) {
+			winners[fold] = slot{entry: e, set: true}
+		}
+	}
+	vars := make(map[string]string, len(winners))
+	for _, s := range winners {
+		vars[s.entry.key] = s.entry.val
+	}
+	return vars
+}
+
+// getvaropts applies the ad-hoc WENV overlay on top of varopts, which
+// holds the rules resolved from the config file.
+func getvaropts(varopts map[string]varopt) error {
 	wenv := os.Getenv("WENV")
 	if wenv == "" {
 		return nil
@@ -242,64 +522,3 @@ func getvaropts() error {
 	}
 	return nil
 }
-
-var wslRoot string
-
-// convert WSL path to Windows path
-func winpath(path string) (string, error) {
-	if wslRoot == "" {
-		getWSLRoot()
-	}
-	re := regexp.MustCompile("^" + wslRoot + "([a-z])(/|$)")
-	match := re.FindStringSubmatch(path)
-	if match != nil {
-		repl := strings.ToUpper(match[1]) + ":"
-		re = regexp.MustCompile("^" + wslRoot + "[a-z]")
-		path = re.ReplaceAllString(path, repl)
-	}
-	path = strings.Replace(path, "/", "\\", -1)
-
-	if strings.HasPrefix(path, "\\") {
-		return "", errors.New("could not convert path")
-	}
-	return path, nil
-}
-
-// convert Windows path to WSL path
-func wslpath(path string) string {
-	if wslRoot == "" {
-		getWSLRoot()
-	}
-	path = strings.Replace(path, "\\", "/", -1)
-	re := regexp.MustCompile("^([A-Za-z]):")
-	match := re.FindStringSubmatch(path)
-	if match != nil {
-		repl := wslRoot + strings.ToLower(match[1])
-		path = re.ReplaceAllString(path, repl)
-	}
-	return path
-}
-
-func getWSLRoot() {
-	wslRoot = "/mnt/"
-	b, err := ioutil.ReadFile("/etc/wsl.conf")
-	if err != nil {
-		return
-	}
-	split := strings.Split(string(b), "\n")
-	for _, s := range split {
-		if !strings.Contains(s, "root") {
-			continue
-		}
-		split := strings.Split(s, "=")
-		if len(split) != 2 {
-			return
-		}
-		s = strings.TrimSpace(split[1])
-		if s[0] == '"' {
-			s = s[1 : len(s)-1]
-		}
-		wslRoot = s
-		return
-	}
-}
@@ -0,0 +1,125 @@
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procCreatePseudoConsole   = kernel32.NewProc("CreatePseudoConsole")
+	procResizePseudoConsole   = kernel32.NewProc("ResizePseudoConsole")
+	procClosePseudoConsole    = kernel32.NewProc("ClosePseudoConsole")
+	procInitProcThreadAttrs   = kernel32.NewProc("InitializeProcThreadAttributeList")
+	procUpdateProcThreadAttr  = kernel32.NewProc("UpdateProcThreadAttribute")
+	procDeleteProcThreadAttrs = kernel32.NewProc("DeleteProcThreadAttributeList")
+)
+
+// procThreadAttributePseudoConsole is PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE.
+const procThreadAttributePseudoConsole = 0x00020016
+
+// extendedStartupInfoPresent is EXTENDED_STARTUPINFO_PRESENT. syscall
+// keeps its own copy unexported, so CreateProcess calls passing a
+// STARTUPINFOEXW need this one.
+const extendedStartupInfoPresent = 0x00080000
+
+// pseudoConsole wraps a ConPTY: writePipe carries keystrokes in to the
+// console and readPipe carries its screen output back out.
+type pseudoConsole struct {
+	handle    syscall.Handle
+	writePipe *os.File
+	readPipe  *os.File
+}
+
+// packCoord packs a COORD the way the Windows x64 calling convention does
+// when passing it by value: X in the low 16 bits, Y in the high 16.
+func packCoord(cols, rows uint16) uintptr {
+	return uintptr(cols) | uintptr(rows)<<16
+}
+
+// newPseudoConsole creates a ConPTY of the given size. The console reads
+// keystrokes written to the returned pseudoConsole.writePipe and writes
+// screen output to pseudoConsole.readPipe; neither pipe end is handed to
+// the child directly, since CreateProcess wires the console up to it via
+// the attribute list built by withPseudoConsoleAttrs instead.
+func newPseudoConsole(cols, rows uint16) (*pseudoConsole, error) {
+	consoleIn, writePipe, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	readPipe, consoleOut, err := os.Pipe()
+	if err != nil {
+		consoleIn.Close()
+		writePipe.Close()
+		return nil, err
+	}
+
+	var handle syscall.Handle
+	r, _, _ := procCreatePseudoConsole.Call(
+		packCoord(cols, rows),
+		consoleIn.Fd(),
+		consoleOut.Fd(),
+		0,
+		uintptr(unsafe.Pointer(&handle)),
+	)
+	consoleIn.Close()
+	consoleOut.Close()
+	if r != 0 {
+		writePipe.Close()
+		readPipe.Close()
+		return nil, fmt.Errorf("CreatePseudoConsole: %w", syscall.Errno(r))
+	}
+	return &pseudoConsole{handle: handle, writePipe: writePipe, readPipe: readPipe}, nil
+}
+
+func (p *pseudoConsole) resize(cols, rows uint16) error {
+	r, _, _ := procResizePseudoConsole.Call(uintptr(p.handle), packCoord(cols, rows))
+	if r != 0 {
+		return fmt.Errorf("ResizePseudoConsole: %w", syscall.Errno(r))
+	}
+	return nil
+}
+
+func (p *pseudoConsole) close() {
+	procClosePseudoConsole.Call(uintptr(p.handle))
+	p.writePipe.Close()
+	p.readPipe.Close()
+}
+
+// startupInfoEx is STARTUPINFOEXW: a STARTUPINFOW immediately followed by
+// the attribute list pointer, which is what lets CreateProcess attach a
+// pseudo console to the child.
+type startupInfoEx struct {
+	syscall.StartupInfo
+	attributeList uintptr
+}
+
+// withPseudoConsoleAttrs builds a single-entry PROC_THREAD_ATTRIBUTE_LIST
+// binding attr to the pseudo console's handle, calls fn with it, and frees
+// it before returning.
+func withPseudoConsoleAttrs(pc *pseudoConsole, fn func(attrList uintptr) error) error {
+	var size uintptr
+	procInitProcThreadAttrs.Call(0, 1, 0, uintptr(unsafe.Pointer(&size)))
+	buf := make([]byte, size)
+	attrList := uintptr(unsafe.Pointer(&buf[0]))
+
+	r, _, e := procInitProcThreadAttrs.Call(attrList, 1, 0, uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return fmt.Errorf("InitializeProcThreadAttributeList: %w", e)
+	}
+	defer procDeleteProcThreadAttrs.Call(attrList)
+
+	r, _, e = procUpdateProcThreadAttr.Call(
+		attrList, 0, procThreadAttributePseudoConsole,
+		uintptr(pc.handle), unsafe.Sizeof(pc.handle), 0, 0,
+	)
+	if r == 0 {
+		return fmt.Errorf("UpdateProcThreadAttribute: %w", e)
+	}
+
+	return fn(attrList)
+}
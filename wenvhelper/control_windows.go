@@ -0,0 +1,51 @@
+// +build windows
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"syscall"
+	"unsafe"
+
+	"rtrn.io/cmd/wenv/handoff"
+)
+
+var (
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procGetExitCodeProcess       = kernel32.NewProc("GetExitCodeProcess")
+)
+
+func generateConsoleCtrlEvent(sig handoff.Signal, processGroupID uint32) error {
+	r, _, e := procGenerateConsoleCtrlEvent.Call(uintptr(sig), uintptr(processGroupID))
+	if r == 0 {
+		return e
+	}
+	return nil
+}
+
+func getExitCodeProcess(h syscall.Handle, code *uint32) error {
+	r, _, e := procGetExitCodeProcess.Call(uintptr(h), uintptr(unsafe.Pointer(code)))
+	if r == 0 {
+		return e
+	}
+	return nil
+}
+
+// readControl decodes handoff.Control messages from r, one per write,
+// calling handle for each until r is closed or done is signaled.
+func readControl(r io.Reader, done <-chan struct{}, handle func(handoff.Control)) {
+	dec := gob.NewDecoder(r)
+	for {
+		var ctrl handoff.Control
+		if err := dec.Decode(&ctrl); err != nil {
+			return
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		handle(ctrl)
+	}
+}
@@ -1,80 +1,271 @@
+//go:build windows
 // +build windows
 
 // Helper application for rtrn.io/cmd/wenv.
 //
-// The first argument is the name of the file containing the gob-encoded
-// environment variables.  The rest of the arguments specify the
-// command to run and its arguments.
+// The first argument is the base64-encoded gob handoff.Payload, passed
+// on argv rather than over an inherited pipe or temp file since argv is
+// the one channel WSL's interop layer is documented to carry into the
+// Win32 process it launches. The rest of the arguments specify the
+// command to run and its arguments. Payload.ControlAddr, if set, is a
+// loopback address wenv is listening on; wenvhelper dials it back for
+// as long as the child runs to receive handoff.Control messages, rather
+// than relying on an inherited file descriptor past fd 2, which the
+// interop boundary above doesn't carry either.
 package main // import "rtrn.io/cmd/wenv/wenvhelper"
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/gob"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"syscall"
-)
+	"unsafe"
 
-const fileprefix = "wenv"
+	"rtrn.io/cmd/wenv/handoff"
+)
 
 func main() {
 	log.SetPrefix("wenvhelper: ")
 	log.SetFlags(0)
 
 	os.Args = os.Args[1:]
-	if len(os.Args) < 3 {
+	if len(os.Args) < 2 {
 		log.Fatal("too few arguments")
 	}
-	if !strings.HasPrefix(filepath.Base(os.Args[0]), fileprefix) {
-		log.Fatalf("%s: invalid first argument", os.Args[0])
-	}
 
-	file, err := os.Open(os.Args[0])
+	raw, err := base64.StdEncoding.DecodeString(os.Args[0])
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("base64 decode: %v", err)
 	}
 	os.Args = os.Args[1:]
-	var vars map[string]string
-	enc := gob.NewDecoder(file)
-	if err := enc.Decode(&vars); err != nil {
+	var payload handoff.Payload
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&payload); err != nil {
 		log.Fatalf("gob decode: %v", err)
 	}
-	if err := file.Close(); err != nil {
-		log.Fatalf("closing temp file: %v", err)
+
+	// env starts from wenvhelper's own inherited environment, with every
+	// key payload.Vars is about to supply stripped out first so the
+	// entries appended below are the only copy of each: otherwise stale
+	// duplicates survive alongside them (notably Windows' own per-drive
+	// current-directory entries, e.g. "=C:", which every process already
+	// carries), and which one the Windows loader honors is
+	// implementation-defined.
+	env := filterEnv(os.Environ(), payload.Vars)
+	for k, v := range payload.Vars {
+		env = append(env, k+"="+v)
+	}
+
+	// A ControlAddr dial failure just means no signal/resize forwarding
+	// for this run, not a fatal error: the target still deserves to
+	// start.
+	var control io.Reader
+	if payload.ControlAddr != "" {
+		conn, err := net.Dial("tcp", payload.ControlAddr)
+		if err != nil {
+			log.Print(err)
+		} else {
+			defer conn.Close()
+			control = conn
+		}
+	}
+
+	var code int
+	if payload.TTY {
+		code, err = runInteractive(os.Args[0], os.Args[1:], env, payload.Cols, payload.Rows, control)
+	} else {
+		code, err = run(os.Args[0], os.Args[1:], env, control)
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(126)
+	}
+	os.Exit(code)
+}
+
+// filterEnv drops every entry of base whose key collides with a key in
+// vars, so the caller can append vars afterwards without leaving a stale
+// duplicate behind it. Every Windows process, including wenvhelper
+// itself, already carries its own "=C:", "=D:", ... per-drive
+// current-directory entries inherited from its parent, so base is
+// expected to collide with vars on exactly those keys as well as on any
+// regular variable the WSL side overrode; which duplicate the Windows
+// loader honors is implementation-defined, so the collision is resolved
+// here instead. Regular keys fold case-insensitively, the way Windows
+// treats them; "=" keys, which are case-sensitive drive letters, compare
+// exactly.
+func filterEnv(base []string, vars map[string]string) []string {
+	folded := make(map[string]struct{}, len(vars))
+	for k := range vars {
+		folded[envFold(k)] = struct{}{}
 	}
-	if err := os.Remove(file.Name()); err != nil {
-		log.Fatalf("removing temp file: %v", err)
+	out := base[:0:0]
+	for _, e := range base {
+		if _, collide := folded[envFold(envKey(e))]; collide {
+			continue
+		}
+		out = append(out, e)
 	}
+	return out
+}
 
-	for k, v := range vars {
-		if err := os.Setenv(k, v); err != nil {
-			log.Fatalf("setenv: %v", err)
+// envKey extracts the key from a raw "key=value" env entry. Entries
+// beginning with "=", such as Windows' per-drive current-directory
+// variables (key "=C:", entry "=C:=C:\work"), carry their own leading
+// "=" as part of the key, so the split happens on the next "=" instead
+// of the first.
+func envKey(e string) string {
+	if strings.HasPrefix(e, "=") {
+		if i := strings.IndexByte(e[1:], '='); i >= 0 {
+			return e[:i+1]
 		}
+		return e
 	}
+	k, _, _ := strings.Cut(e, "=")
+	return k
+}
 
+// envFold returns the form an env key collides under on Windows:
+// case-insensitive, except "=" keys (case-sensitive drive letters),
+// which compare exactly.
+func envFold(k string) string {
+	if strings.HasPrefix(k, "=") {
+		return k
+	}
+	return strings.ToLower(k)
+}
+
+// run starts path as a plain child, its own stdio wired straight to
+// wenvhelper's, the way it was before -t existed. It still forwards
+// console control events off control, if non-nil, raising them in the
+// child's own process group so a Ctrl-C at the WSL terminal can interrupt
+// it without also killing wenvhelper.
+func run(path string, args []string, env []string, control io.Reader) (int, error) {
 	cmd := exec.Cmd{
-		Path:   os.Args[0],
-		Args:   os.Args[1:],
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Path:        path,
+		Args:        args,
+		Env:         env,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP},
 	}
 	if err := cmd.Start(); err != nil {
-		log.Print(err)
-		os.Exit(126)
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if control != nil {
+		go readControl(control, done, func(ctrl handoff.Control) {
+			if ctrl.Kind == handoff.ControlSignal {
+				generateConsoleCtrlEvent(ctrl.Signal, uint32(cmd.Process.Pid))
+			}
+		})
 	}
-	code := 0
+
 	if err := cmd.Wait(); err != nil {
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				code = status.ExitStatus()
+				return status.ExitStatus(), nil
 			}
-		} else {
-			log.Print(err)
-			os.Exit(126)
 		}
+		return 0, err
 	}
-	os.Exit(code)
+	return 0, nil
+}
+
+// runInteractive starts path attached to a new ConPTY sized cols by rows,
+// pumping its screen output to wenvhelper's stdout and keystrokes from
+// wenvhelper's stdin to it, and applies control messages (console events,
+// resizes) as they arrive for as long as the child runs.
+func runInteractive(path string, args []string, env []string, cols, rows uint16, control io.Reader) (int, error) {
+	pc, err := newPseudoConsole(cols, rows)
+	if err != nil {
+		return 0, err
+	}
+	defer pc.close()
+
+	appName, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var line string
+	for i, a := range args {
+		if i > 0 {
+			line += " "
+		}
+		line += syscall.EscapeArg(a)
+	}
+	cmdLine, err := syscall.UTF16PtrFromString(line)
+	if err != nil {
+		return 0, err
+	}
+	envBlock, err := buildEnvBlock(env)
+	if err != nil {
+		return 0, err
+	}
+
+	var procInfo syscall.ProcessInformation
+	err = withPseudoConsoleAttrs(pc, func(attrList uintptr) error {
+		var si startupInfoEx
+		si.attributeList = attrList
+		si.Cb = uint32(unsafe.Sizeof(si))
+		flags := uint32(syscall.CREATE_UNICODE_ENVIRONMENT | extendedStartupInfoPresent | syscall.CREATE_NEW_PROCESS_GROUP)
+		return syscall.CreateProcess(
+			appName, cmdLine, nil, nil, false, flags,
+			envBlock, nil,
+			(*syscall.StartupInfo)(unsafe.Pointer(&si)), &procInfo,
+		)
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(procInfo.Thread)
+	defer syscall.CloseHandle(procInfo.Process)
+
+	done := make(chan struct{})
+	defer close(done)
+	if control != nil {
+		go readControl(control, done, func(ctrl handoff.Control) {
+			switch ctrl.Kind {
+			case handoff.ControlSignal:
+				generateConsoleCtrlEvent(ctrl.Signal, procInfo.ProcessId)
+			case handoff.ControlResize:
+				pc.resize(ctrl.Cols, ctrl.Rows)
+			}
+		})
+	}
+	go io.Copy(pc.writePipe, os.Stdin)
+	go io.Copy(os.Stdout, pc.readPipe)
+
+	if _, err := syscall.WaitForSingleObject(procInfo.Process, syscall.INFINITE); err != nil {
+		return 0, err
+	}
+	var exitCode uint32
+	if err := getExitCodeProcess(procInfo.Process, &exitCode); err != nil {
+		return 0, err
+	}
+	return int(exitCode), nil
+}
+
+// buildEnvBlock turns a slice of "key=value" strings into the
+// NUL-delimited, doubly-NUL-terminated block CreateProcess expects.
+func buildEnvBlock(env []string) (*uint16, error) {
+	var block []uint16
+	for _, kv := range env {
+		u, err := syscall.UTF16FromString(kv)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, u[:len(u)-1]...) // drop kv's own NUL, added back below
+		block = append(block, 0)
+	}
+	block = append(block, 0)
+	return &block[0], nil
 }
@@ -0,0 +1,84 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "testing"
+
+func TestFilterEnvDropsOnlyCollidingKeys(t *testing.T) {
+	base := []string{"PATH=old", "HOME=/me", "=C:=C:\\old"}
+	vars := map[string]string{"Path": "new", "=C:": "C:\\new"}
+
+	got := filterEnv(base, vars)
+	want := []string{"HOME=/me"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFilterEnvLeavesNonCollidingEntriesAlone(t *testing.T) {
+	base := []string{"PATH=old", "TEMP=C:\\Windows\\Temp"}
+	vars := map[string]string{"HOME": "/me"}
+
+	got := filterEnv(base, vars)
+	if len(got) != 2 || got[0] != base[0] || got[1] != base[1] {
+		t.Fatalf("got %v, want base unchanged", got)
+	}
+}
+
+func TestFilterEnvThenAppendRoundTripsPayloadVars(t *testing.T) {
+	// Regression test for the bug where filterEnv, run after os.Setenv had
+	// already mutated os.Environ(), stripped the very entries it was
+	// meant to protect: every regular key in payload.Vars vanished from
+	// the child's environment entirely.
+	base := []string{"PATH=C:\\old", "HOME=/old", "=C:=C:\\old"}
+	vars := map[string]string{"PATH": "C:\\new", "HOME": "/new", "=C:": "C:\\new"}
+
+	env := filterEnv(base, vars)
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+
+	for k, v := range vars {
+		want := k + "=" + v
+		found := false
+		for _, e := range env {
+			if e == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("env %v missing %q", env, want)
+		}
+	}
+	if len(env) != len(vars) {
+		t.Fatalf("got %d entries, want %d (no stale duplicates): %v", len(env), len(vars), env)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	cases := map[string]string{
+		"PATH=/a:/b":   "PATH",
+		"HOME=":        "HOME",
+		"=C:=C:\\work": "=C:",
+		"=C:":          "=C:",
+	}
+	for e, want := range cases {
+		if got := envKey(e); got != want {
+			t.Errorf("envKey(%q) = %q, want %q", e, got, want)
+		}
+	}
+}
+
+func TestEnvFold(t *testing.T) {
+	if envFold("Path") != envFold("PATH") {
+		t.Fatal("want regular keys to fold case-insensitively")
+	}
+	if envFold("=C:") == envFold("=D:") {
+		t.Fatal("want distinct drive keys to stay distinct")
+	}
+	if envFold("=c:") == envFold("=C:") {
+		t.Fatal("want \"=\" keys to compare case-sensitively")
+	}
+}
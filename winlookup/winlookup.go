@@ -0,0 +1,138 @@
+// +build linux
+
+// Package winlookup resolves Windows executables from the WSL side, the
+// way os/exec.LookPath resolves Unix ones. exec.LookPath only ever checks
+// WSL's own $PATH, so it requires spelling out "command.exe" and having it
+// on that $PATH; winlookup instead walks the Windows-side PATH and honors
+// PATHEXT, so a bare "go" resolves to "go.exe" the way it would from
+// cmd.exe.
+package winlookup // import "rtrn.io/cmd/wenv/winlookup"
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"rtrn.io/cmd/wenv/pathconv"
+)
+
+// defaultPathext mirrors cmd.exe's built-in default for when %PATHEXT%
+// is not set.
+const defaultPathext = ".COM;.EXE;.BAT;.CMD"
+
+// LookWindows resolves name the way Windows' CreateProcess does: if name
+// already contains a path separator ('/' or '\\') it is used as-is,
+// otherwise each directory of the Windows PATH is searched, trying name
+// with each of PATHEXT's extensions in turn unless name already has one of
+// its own. It returns the match both as reachable from WSL and in its
+// native Windows form.
+func LookWindows(name string) (linuxPath, windowsPath string, err error) {
+	if strings.ContainsAny(name, `/\`) {
+		return lookAbsolute(name)
+	}
+
+	winPath, err := windowsSystemPath()
+	if err != nil {
+		return "", "", err
+	}
+	exts := pathext()
+	candidates := []string{name}
+	if !hasExt(name, exts) {
+		candidates = candidates[:0]
+		for _, ext := range exts {
+			candidates = append(candidates, name+ext)
+		}
+	}
+
+	for _, dir := range strings.Split(winPath, ";") {
+		if dir == "" {
+			continue
+		}
+		for _, cand := range candidates {
+			winCandidate := strings.TrimRight(dir, `\`) + `\` + cand
+			linuxCandidate, err := pathconv.ToLinux(winCandidate)
+			if err != nil {
+				continue
+			}
+			if isExecutableFile(linuxCandidate) {
+				return linuxCandidate, winCandidate, nil
+			}
+		}
+	}
+	return "", "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// lookAbsolute resolves a name that already contains a path separator,
+// mirroring lp_windows.go: the name is used as given, trying each
+// PATHEXT extension in turn when it doesn't already have one, and a
+// candidate only counts as a match once it's confirmed to exist.
+func lookAbsolute(name string) (linuxPath, windowsPath string, err error) {
+	exts := pathext()
+	candidates := []string{name}
+	if !hasExt(name, exts) {
+		candidates = candidates[:0]
+		for _, ext := range exts {
+			candidates = append(candidates, name+ext)
+		}
+	}
+
+	windowsStyle := strings.Contains(name, `\`)
+	for _, cand := range candidates {
+		if windowsStyle {
+			linuxCand, err := pathconv.ToLinux(cand)
+			if err != nil {
+				continue
+			}
+			if isExecutableFile(linuxCand) {
+				return linuxCand, cand, nil
+			}
+			continue
+		}
+		if !isExecutableFile(cand) {
+			continue
+		}
+		winCand, err := pathconv.ToWindows(cand)
+		if err != nil {
+			return "", "", err
+		}
+		return cand, winCand, nil
+	}
+	return "", "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// windowsSystemPath returns the Windows-side PATH. WENV_WINPATH lets callers
+// supply it directly, sidestepping the cmd.exe round trip; otherwise it is
+// read from cmd.exe, the same way wenv reads %TEMP%.
+func windowsSystemPath() (string, error) {
+	if p := os.Getenv("WENV_WINPATH"); p != "" {
+		return p, nil
+	}
+	out, err := exec.Command("cmd.exe", "/c", "echo %PATH%").Output()
+	if err != nil {
+		return "", fmt.Errorf("winlookup: exec cmd.exe: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func pathext() []string {
+	p := os.Getenv("PATHEXT")
+	if p == "" {
+		p = defaultPathext
+	}
+	return strings.Split(p, ";")
+}
+
+func hasExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func isExecutableFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
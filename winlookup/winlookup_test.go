@@ -0,0 +1,99 @@
+// +build linux
+
+package winlookup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasExt(t *testing.T) {
+	exts := []string{".COM", ".EXE", ".BAT", ".CMD"}
+	cases := map[string]bool{
+		"go.exe":  true,
+		"go.EXE":  true,
+		"go":      false,
+		"go.exem": false,
+	}
+	for name, want := range cases {
+		if got := hasExt(name, exts); got != want {
+			t.Errorf("hasExt(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLookAbsoluteWindowsStyle(t *testing.T) {
+	// fallbackToLinux only rewrites a leading drive letter, so a
+	// backslash-separated name rooted at a real WSL directory round-trips
+	// through it unchanged apart from the separators, letting the test
+	// point at a file that actually exists without a real Windows drive.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cmd.exe"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	name := dir + `\cmd.exe`
+
+	linuxPath, windowsPath, err := lookAbsolute(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if windowsPath != name {
+		t.Fatalf("got windowsPath %q, want it unchanged", windowsPath)
+	}
+	if want := filepath.Join(dir, "cmd.exe"); linuxPath != want {
+		t.Fatalf("got linuxPath %q, want %q", linuxPath, want)
+	}
+}
+
+func TestLookAbsoluteWindowsStyleMissing(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := lookAbsolute(dir + `\nosuch.exe`)
+	if exerr, ok := err.(*exec.Error); !ok || exerr.Err != exec.ErrNotFound {
+		t.Fatalf("got %v, want exec.ErrNotFound", err)
+	}
+}
+
+func TestLookAbsoluteWindowsStylePathext(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tool.BAT"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PATHEXT", ".EXE;.BAT;.CMD")
+	defer os.Unsetenv("PATHEXT")
+
+	linuxPath, windowsPath, err := lookAbsolute(dir + `\tool`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, "tool.BAT"); linuxPath != want {
+		t.Fatalf("got linuxPath %q, want %q", linuxPath, want)
+	}
+	if want := dir + `\tool.BAT`; windowsPath != want {
+		t.Fatalf("got windowsPath %q, want %q", windowsPath, want)
+	}
+}
+
+func TestLookWindowsSearchesPathextOrder(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tool.BAT"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("WENV_WINPATH", `C:\nonexistent;`+dir)
+	defer os.Unsetenv("WENV_WINPATH")
+	os.Setenv("PATHEXT", ".EXE;.BAT;.CMD")
+	defer os.Unsetenv("PATHEXT")
+
+	linuxPath, windowsPath, err := LookWindows("tool")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if linuxPath != filepath.Join(dir, "tool.BAT") {
+		t.Fatalf("got linuxPath %q", linuxPath)
+	}
+	if windowsPath == "" {
+		t.Fatal("want a non-empty windowsPath")
+	}
+}